@@ -0,0 +1,277 @@
+package icinga2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// EventType identifies the kind of event delivered over an Icinga2 Event
+// Streams subscription. See the "types" parameter of the Icinga2 API's
+// /v1/events endpoint.
+type EventType string
+
+const (
+	EventTypeCheckResult          EventType = "CheckResult"
+	EventTypeStateChange          EventType = "StateChange"
+	EventTypeNotification         EventType = "Notification"
+	EventTypeAcknowledgementSet   EventType = "AcknowledgementSet"
+	EventTypeAcknowledgementClear EventType = "AcknowledgementCleared"
+	EventTypeDowntimeAdded        EventType = "DowntimeAdded"
+	EventTypeDowntimeRemoved      EventType = "DowntimeRemoved"
+	EventTypeDowntimeStarted      EventType = "DowntimeStarted"
+	EventTypeDowntimeTriggered    EventType = "DowntimeTriggered"
+)
+
+// EventCheckResult mirrors the "check_result" object embedded in CheckResult
+// and StateChange events.
+type EventCheckResult struct {
+	Output         string   `json:"output"`
+	ExitStatus     int      `json:"exit_status"`
+	State          int      `json:"state"`
+	Command        []string `json:"command,omitempty"`
+	ExecutionStart float64  `json:"execution_start,omitempty"`
+	ExecutionEnd   float64  `json:"execution_end,omitempty"`
+}
+
+// Event is the envelope for a single line of an Icinga2 Event Streams
+// response. Which fields are populated depends on Type; e.g. CheckResult
+// and StateChange populate CheckResult/State/StateType, Notification
+// populates NotificationType, and the downtime/acknowledgement events
+// populate the remaining fields.
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp float64   `json:"timestamp"`
+	Host      string    `json:"host,omitempty"`
+	Service   string    `json:"service,omitempty"`
+
+	CheckResult *EventCheckResult `json:"check_result,omitempty"`
+	State       int               `json:"state,omitempty"`
+	StateType   int               `json:"state_type,omitempty"`
+
+	NotificationType string   `json:"notification_type,omitempty"`
+	Users            []string `json:"users,omitempty"`
+
+	Author string `json:"author,omitempty"`
+	Text   string `json:"text,omitempty"`
+
+	DowntimeName string `json:"downtime_name,omitempty"`
+}
+
+// EventFilter describes an Icinga2 Event Streams subscription: the event
+// Types to deliver, the named Queue (Icinga2 requires a unique queue name
+// per subscription), and an optional Filter DSL expression restricting
+// which objects' events are delivered.
+type EventFilter struct {
+	Types  []EventType
+	Queue  string
+	Filter string
+}
+
+func (f EventFilter) requestBody() map[string]interface{} {
+	body := map[string]interface{}{
+		"types": f.Types,
+		"queue": f.Queue,
+	}
+	if f.Filter != "" {
+		body["filter"] = f.Filter
+	}
+	return body
+}
+
+// SubscribeEvents opens a long-lived subscription to the Icinga2 API's
+// Event Streams endpoint and decodes newline-delimited JSON events onto the
+// returned channel until ctx is cancelled. Transient connection failures
+// and 5xx responses are retried against the configured endpoints with the
+// backoff and cool-down of s.RetryPolicy, without a limit on the number of
+// reconnects (MaxAttempts is not applied). The error channel receives a
+// value only when subscribing is abandoned: Icinga2 rejects the
+// subscription with a 4xx status, or no endpoints are configured.
+// Cancelling ctx ends the subscription without sending an error. Both
+// channels are closed once the subscription ends.
+func (s *WebClient) SubscribeEvents(ctx context.Context, filter EventFilter) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	go s.streamEvents(ctx, filter, events, errs)
+
+	return events, errs
+}
+
+func (s *WebClient) streamEvents(ctx context.Context, filter EventFilter, events chan<- Event, errs chan<- error) {
+	defer close(events)
+	defer close(errs)
+
+	skip := make(map[*endpoint]bool)
+	attempt := 0
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		ep := s.nextEndpoint(skip)
+		if ep == nil {
+			errs <- fmt.Errorf("icinga2: no available endpoints")
+			return
+		}
+
+		err := s.streamEventsOnce(ctx, ep, filter, events)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		var perm *permanentEventsError
+		if errors.As(err, &perm) {
+			s.Logger.Errorw("icinga2 event stream rejected", "url", ep.url, "queue", filter.Queue, "error", perm.err.Error())
+			errs <- perm.err
+			return
+		}
+
+		ep.recordFailure(s.RetryPolicy.CoolDown)
+		s.Logger.Errorw("icinga2 event stream disconnected", "url", ep.url, "queue", filter.Queue, "error", err.Error())
+
+		// Mark this endpoint as tried so a reconnect prefers one of its
+		// siblings; once every endpoint has failed once, forget that and
+		// let round-robin cycle through them again rather than refusing
+		// all of them forever.
+		skip[ep] = true
+		if len(skip) >= len(s.endpoints) {
+			skip = make(map[*endpoint]bool)
+		}
+
+		attempt++
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.RetryPolicy.backoff(attempt)):
+		}
+	}
+}
+
+// permanentEventsError marks a streamEventsOnce failure as not worth
+// retrying - the caller should surface it on the errors channel instead of
+// reconnecting.
+type permanentEventsError struct {
+	err error
+}
+
+func (e *permanentEventsError) Error() string { return e.err.Error() }
+
+// streamEventsOnce performs a single connection attempt, decoding events
+// until the connection drops or ctx is cancelled. A nil return means ctx
+// was cancelled (the caller should stop); a *permanentEventsError means
+// Icinga2 rejected the subscription with a 4xx status (the caller should
+// stop and report it); any other return is a transient disconnection the
+// caller should reconnect after.
+func (s *WebClient) streamEventsOnce(ctx context.Context, ep *endpoint, filter EventFilter, events chan<- Event) error {
+	body, err := json.Marshal(filter.requestBody())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ep.url+"/v1/events", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.Username != "" || s.Password != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	// No response timeout: the connection is held open for as long as
+	// events are flowing, and is only ever torn down via ctx.
+	client := &http.Client{Transport: s.transport}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		statusErr := fmt.Errorf("icinga2: subscribe events: %s", resp.Status)
+		if resp.StatusCode < 500 {
+			// A 4xx here is Icinga2 rejecting the subscription itself (bad
+			// filter syntax, bad credentials, a queue name already in use
+			// by another subscriber) rather than a transient failure -
+			// retrying it would just spin forever, so surface it as
+			// terminal instead of reconnecting.
+			return &permanentEventsError{err: statusErr}
+		}
+		return statusErr
+	}
+
+	ep.recordSuccess()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			s.Logger.Errorw("icinga2 event decode error", "queue", filter.Queue, "error", err.Error())
+			continue
+		}
+
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// SubscribeEvents lets tests push synthetic events (via PushEvent) through
+// the same channel-based API as WebClient.
+func (m *MockClient) SubscribeEvents(ctx context.Context, filter EventFilter) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-m.events:
+				if !ok {
+					return
+				}
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// PushEvent delivers ev to any subscriber started via SubscribeEvents.
+func (m *MockClient) PushEvent(ev Event) {
+	m.events <- ev
+}
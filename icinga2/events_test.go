@@ -0,0 +1,42 @@
+package icinga2
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMockClientSubscribeEvents(t *testing.T) {
+	m := NewMockClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, errs := m.SubscribeEvents(ctx, EventFilter{
+		Types: []EventType{EventTypeStateChange},
+		Queue: "test",
+	})
+
+	m.PushEvent(Event{Type: EventTypeStateChange, Host: "host1", State: 2})
+
+	select {
+	case ev := <-events:
+		if ev.Host != "host1" || ev.State != 2 {
+			t.Fatalf("got %+v, want Host=host1 State=2", ev)
+		}
+	case err := <-errs:
+		t.Fatalf("unexpected error: %s", err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for pushed event")
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected events channel to be closed after context cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for events channel to close")
+	}
+}
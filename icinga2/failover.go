@@ -0,0 +1,229 @@
+package icinga2
+
+import (
+	"crypto/tls"
+	"fmt"
+	"gopkg.in/jmcvetta/napping.v3"
+	"math/rand"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy controls how WebClient.do retries a request across the
+// configured endpoints. Only idempotent verbs are retried: GET, PUT (object
+// create-if-not-exists) and POST to ProcessCheckResult, which Icinga2 treats
+// idempotently. 4xx responses from handleResults are never retried, since
+// they indicate a request Icinga2 has rejected rather than a transient
+// failure.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64
+
+	// CoolDown is how long an endpoint whose last request failed (an error,
+	// or a 5xx status) is skipped before being tried again, so a dead master
+	// doesn't dominate request latency.
+	CoolDown time.Duration
+}
+
+// DefaultRetryPolicy is used when a WebClient is constructed without an
+// explicit RetryPolicy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Jitter:         0.2,
+		CoolDown:       30 * time.Second,
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff << uint(attempt)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	jitter := time.Duration(float64(d) * p.Jitter * (rand.Float64()*2 - 1))
+	return d + jitter
+}
+
+// endpoint tracks the health of a single Icinga2 API URL so that a
+// round-robin do() can skip endpoints that are in cool-down after a failed
+// request. A single failure starts the cool-down; a success clears it.
+type endpoint struct {
+	url string
+
+	mutex        sync.Mutex
+	coolDownTill time.Time
+}
+
+func (e *endpoint) available(now time.Time) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return now.After(e.coolDownTill)
+}
+
+func (e *endpoint) recordFailure(coolDown time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.coolDownTill = time.Now().Add(coolDown)
+}
+
+func (e *endpoint) recordSuccess() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.coolDownTill = time.Time{}
+}
+
+// nextEndpoint returns the next endpoint to try in round-robin order,
+// preferring one that is both unskipped and not in cool-down. It degrades
+// gracefully as options run out: if every endpoint is cooling down it
+// returns the next unskipped one anyway, and if every endpoint is skipped
+// too (the single-endpoint case, or every endpoint tried once already) it
+// still returns one rather than nil, since the caller has nowhere else to
+// send the request.
+func (s *WebClient) nextEndpoint(skip map[*endpoint]bool) *endpoint {
+	n := len(s.endpoints)
+	if n == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	start := int(atomic.AddUint64(&s.endpointCtr, 1) - 1)
+
+	var skippedFallback *endpoint
+	for i := 0; i < n; i++ {
+		ep := s.endpoints[(start+i)%n]
+		if skip[ep] {
+			if skippedFallback == nil {
+				skippedFallback = ep
+			}
+			continue
+		}
+		if ep.available(now) {
+			return ep
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		ep := s.endpoints[(start+i)%n]
+		if !skip[ep] {
+			return ep
+		}
+	}
+
+	return skippedFallback
+}
+
+// do performs an HTTP request via napping, retrying across endpoints
+// according to s.RetryPolicy. verb is "GET", "PUT" or "POST".
+func (s *WebClient) do(verb, path string, body interface{}, results, errmsg *Results) (*napping.Response, error) {
+	if len(s.endpoints) == 0 {
+		return nil, fmt.Errorf("icinga2: no endpoints configured")
+	}
+
+	policy := s.RetryPolicy
+	tried := make(map[*endpoint]bool)
+
+	// POST is only retried for process-check-result; other POSTs (object
+	// updates) are sent once.
+	retryable := verb != "POST" || strings.HasPrefix(path, "/v1/actions/process-check-result")
+
+	var resp *napping.Response
+	var err error
+
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		ep := s.nextEndpoint(tried)
+		tried[ep] = true
+
+		url := ep.url + path
+		switch verb {
+		case "GET":
+			resp, err = s.napping.Get(url, nil, results, errmsg)
+		case "PUT":
+			resp, err = s.napping.Put(url, body, results, errmsg)
+		case "POST":
+			resp, err = s.napping.Post(url, body, results, errmsg)
+		default:
+			return nil, fmt.Errorf("icinga2: unsupported verb %q", verb)
+		}
+
+		if err != nil {
+			if isRetryableError(err) {
+				ep.recordFailure(policy.CoolDown)
+				s.Logger.Errorw("icinga2 endpoint failure", "url", ep.url, "attempt", attempt, "error", err.Error())
+				if retryable && attempt < policy.MaxAttempts-1 {
+					time.Sleep(policy.backoff(attempt))
+					continue
+				}
+				return resp, err
+			}
+
+			// Not retryable, but still a failed request against this
+			// endpoint - record it so the cool-down engages instead of
+			// leaving the endpoint looking healthy.
+			ep.recordFailure(policy.CoolDown)
+			return resp, err
+		}
+
+		if resp != nil && isRetryableStatus(resp.HttpResponse().StatusCode) {
+			ep.recordFailure(policy.CoolDown)
+			if retryable && attempt < policy.MaxAttempts-1 {
+				time.Sleep(policy.backoff(attempt))
+				continue
+			}
+			return resp, err
+		}
+
+		ep.recordSuccess()
+		return resp, err
+	}
+
+	return resp, err
+}
+
+// isRetryableError classifies connection resets and TLS failures (including
+// certificate verification failures, e.g. an expired or misconfigured cert
+// on one satellite) as retryable; anything else (including errors from
+// handleResults, which only sees 4xx application errors) is not. net/http
+// wraps transport errors in *url.Error regardless of whether they're
+// transient, so that layer is unwrapped first rather than trusting the
+// broader net.Error interface, which *url.Error itself satisfies for both
+// transient and permanent failures. A per-endpoint certificate problem is
+// exactly the kind of failure multi-endpoint failover exists to route
+// around, so it must be retryable here even though it isn't itself
+// transient - otherwise do() gives up on the first endpoint instead of
+// trying a sibling with a working certificate.
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	if _, ok := err.(*net.OpError); ok {
+		return true
+	}
+	if _, ok := err.(tls.RecordHeaderError); ok {
+		return true
+	}
+	if t := reflect.TypeOf(err); t != nil && t.PkgPath() == "crypto/x509" {
+		return true
+	}
+	return false
+}
+
+// isRetryableStatus reports whether an HTTP status code indicates a
+// transient server-side failure worth retrying against another endpoint.
+// 4xx statuses are never retryable; they're Icinga2 rejecting the request.
+func isRetryableStatus(status int) bool {
+	return status >= 500
+}
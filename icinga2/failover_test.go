@@ -0,0 +1,127 @@
+package icinga2
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"nil", nil, false},
+		{"net.OpError", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{
+			"net.OpError wrapped in url.Error",
+			&url.Error{Op: "Get", URL: "https://icinga", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+			true,
+		},
+		{"tls.RecordHeaderError", tls.RecordHeaderError{}, true},
+		{"x509 certificate error", x509.UnknownAuthorityError{}, true},
+		{
+			"x509 certificate error wrapped in url.Error",
+			&url.Error{Op: "Get", URL: "https://icinga", Err: x509.HostnameError{}},
+			true,
+		},
+		{"generic application error", fmt.Errorf("create /hosts/x : 404 Not Found"), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isRetryableError(c.err); got != c.retryable {
+				t.Fatalf("isRetryableError(%v) = %v, want %v", c.err, got, c.retryable)
+			}
+		})
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	cases := []struct {
+		status    int
+		retryable bool
+	}{
+		{200, false},
+		{404, false},
+		{499, false},
+		{500, true},
+		{503, true},
+	}
+
+	for _, c := range cases {
+		if got := isRetryableStatus(c.status); got != c.retryable {
+			t.Fatalf("isRetryableStatus(%d) = %v, want %v", c.status, got, c.retryable)
+		}
+	}
+}
+
+// TestDoFailsOverToHealthyEndpoint drives do() (via CreateObject) against a
+// dead first endpoint and a healthy second one, and checks that the dead
+// one is left in cool-down rather than marked healthy.
+func TestDoFailsOverToHealthyEndpoint(t *testing.T) {
+	good := httptest.NewServer(newResultsHandler())
+	defer good.Close()
+
+	// Nothing listens here, so requests fail fast with a connection-refused
+	// *net.OpError instead of hanging until a dial timeout.
+	const deadURL = "http://127.0.0.1:1"
+
+	client, err := New(WebClient{
+		URLs: []string{deadURL, good.URL},
+		RetryPolicy: RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+			CoolDown:       time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	if err := client.CreateObject("/hosts/test1", map[string]interface{}{"attrs": map[string]interface{}{}}); err != nil {
+		t.Fatalf("CreateObject: %s", err)
+	}
+
+	dead := client.endpoints[0]
+	if dead.available(time.Now()) {
+		t.Fatal("expected the dead endpoint to be in cool-down after failing over, not marked healthy")
+	}
+}
+
+// TestDoRecordsFailureForNonRetryableError covers the bug where a
+// non-retryable error still fell through to recordSuccess, because only the
+// retryable branch called recordFailure - silently clearing the cool-down
+// for an endpoint that had in fact just failed.
+func TestDoRecordsFailureForNonRetryableError(t *testing.T) {
+	client, err := New(WebClient{
+		// A malformed URL fails with a plain "missing protocol scheme"
+		// error - not a *net.OpError, tls error or x509 error - so it's
+		// exactly the non-retryable case the do() fallthrough mishandled.
+		URL: "://bad-url",
+		RetryPolicy: RetryPolicy{
+			MaxAttempts: 2,
+			CoolDown:    time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	if err := client.CreateObject("/hosts/test1", map[string]interface{}{"attrs": map[string]interface{}{}}); err == nil {
+		t.Fatal("expected CreateObject to fail against a malformed URL")
+	}
+
+	ep := client.endpoints[0]
+	if ep.available(time.Now()) {
+		t.Fatal("expected the endpoint to be recorded unhealthy after a non-retryable error")
+	}
+}
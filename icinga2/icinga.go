@@ -1,6 +1,7 @@
 package icinga2
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Client interface {
@@ -33,18 +36,53 @@ type Client interface {
 	UpdateService(Service) error
 
 	ProcessCheckResult(Service, Action) error
+
+	SubscribeEvents(ctx context.Context, filter EventFilter) (<-chan Event, <-chan error)
 }
 
 type WebClient struct {
-	napping           napping.Session
-	URL               string
+	napping napping.Session
+
+	// URL is a shortcut for a single-endpoint deployment; New() uses it as
+	// the only endpoint if URLs is empty (URLs itself is left unchanged).
+	// Prefer URLs for Icinga2 HA setups
+	// with multiple master/satellite endpoints serving the same zone.
+	URL  string
+	URLs []string
+
 	Username          string
 	Password          string
-	Debug             bool
 	InsecureTLS       bool
 	DisableKeepAlives bool
 	Zone              string
 	RootCAs           *x509.CertPool
+
+	// RetryPolicy controls retries across endpoints for idempotent verbs.
+	// The zero value is replaced with DefaultRetryPolicy() by New().
+	RetryPolicy RetryPolicy
+
+	// Logger receives structured events for every request (method, path,
+	// status, duration_ms, icinga_result_code, errors). It defaults to a
+	// no-op implementation; use NewStdLogger or NewZapLogger to plug the
+	// client into an existing logging pipeline.
+	Logger Logger
+
+	// ClientCertificate and ClientKey are paths to a PEM encoded X.509
+	// client certificate/key pair used for mutual TLS authentication
+	// against the Icinga2 API. They are ignored if Certificate is set.
+	ClientCertificate string
+	ClientKey         string
+
+	// Certificate is an already-loaded client certificate, used in
+	// preference to ClientCertificate/ClientKey when set. Either form lets
+	// username/password be omitted in favour of certificate-based auth.
+	Certificate *tls.Certificate
+
+	transport *http.Transport
+	caPool    atomic.Value // holds *x509.CertPool
+
+	endpoints   []*endpoint
+	endpointCtr uint64 // round-robin cursor, advanced with atomic.AddUint64
 }
 
 type MockClient struct {
@@ -53,6 +91,8 @@ type MockClient struct {
 	Services   map[string]Service
 	Actions    map[string][]Action
 	mutex      sync.Mutex
+
+	events chan Event
 }
 
 type Vars map[string]interface{}
@@ -73,26 +113,103 @@ func New(s WebClient) (*WebClient, error) {
 	if rootCAs == nil {
 		rootCAs, _ = x509.SystemCertPool()
 	}
+	s.caPool.Store(rootCAs)
+
+	// Verification is done in VerifyConnection instead of leaving it to the
+	// standard library, so that it always reads s.caPool rather than a
+	// RootCAs pool baked into the tls.Config at construction time; that's
+	// what lets SetRootCAs/WatchCAFile rotate the trust store of a
+	// long-lived client without tearing it down (GetConfigForClient is a
+	// server-side hook and isn't consulted by an HTTP client, so it can't
+	// be used for this).
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+	}
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if s.InsecureTLS {
+			return nil
+		}
+
+		opts := x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         s.caPool.Load().(*x509.CertPool),
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+
+	cert, err := s.clientCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
 	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: s.InsecureTLS,
-			RootCAs:            rootCAs,
-		},
-                DisableKeepAlives: s.DisableKeepAlives,
+		TLSClientConfig:   tlsConfig,
+		DisableKeepAlives: s.DisableKeepAlives,
 	}
+	s.transport = transport
 	client := &http.Client{Transport: transport}
 
+	if s.Logger == nil {
+		s.Logger = nopLogger{}
+	}
+
 	s.napping = napping.Session{
-		Log:      s.Debug,
-		Client:   client,
-		Userinfo: url.UserPassword(s.Username, s.Password),
+		Client: client,
+	}
+
+	if s.Username != "" || s.Password != "" {
+		s.napping.Userinfo = url.UserPassword(s.Username, s.Password)
 	}
 
 	s.URL = strings.TrimRight(s.URL, "/")
 
+	urls := s.URLs
+	if len(urls) == 0 {
+		urls = []string{s.URL}
+	}
+	s.endpoints = make([]*endpoint, len(urls))
+	for i, u := range urls {
+		s.endpoints[i] = &endpoint{url: strings.TrimRight(u, "/")}
+	}
+
+	if s.RetryPolicy.MaxAttempts == 0 {
+		s.RetryPolicy = DefaultRetryPolicy()
+	}
+
 	return &s, nil
 }
 
+// clientCertificate resolves the client certificate to present for mutual
+// TLS, preferring an already-loaded Certificate over the
+// ClientCertificate/ClientKey file paths. It returns a nil certificate (and
+// nil error) when neither is configured, so that username/password
+// authentication can be used instead.
+func (s *WebClient) clientCertificate() (*tls.Certificate, error) {
+	if s.Certificate != nil {
+		return s.Certificate, nil
+	}
+
+	if s.ClientCertificate == "" && s.ClientKey == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.ClientCertificate, s.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate %s / key %s: %s", s.ClientCertificate, s.ClientKey, err)
+	}
+
+	return &cert, nil
+}
+
 func NewMockClient() (c *MockClient) {
 	c = new(MockClient)
 	c.Hostgroups = make(map[string]HostGroup)
@@ -100,6 +217,7 @@ func NewMockClient() (c *MockClient) {
 	c.Services = make(map[string]Service)
 	c.Actions = make(map[string][]Action)
 	c.mutex = sync.Mutex{}
+	c.events = make(chan Event, 16)
 	return
 }
 
@@ -116,7 +234,9 @@ type Results struct {
 func (s *WebClient) CreateObject(path string, create interface{}) error {
 	var results, errmsg Results
 
-	resp, err := s.napping.Put(s.URL+"/v1/objects"+path, create, &results, &errmsg)
+	start := time.Now()
+	resp, err := s.do("PUT", "/v1/objects"+path, create, &results, &errmsg)
+	s.Logger.Debugw("icinga2 request", "method", "PUT", "path", path, "duration_ms", time.Since(start).Milliseconds())
 
 	return s.handleResults("create", path, resp, &results, &errmsg, err)
 }
@@ -124,7 +244,10 @@ func (s *WebClient) CreateObject(path string, create interface{}) error {
 func (s *WebClient) UpdateObject(path string, create interface{}) error {
 	var results, errmsg Results
 
-	resp, err := s.napping.Post(s.URL+"/v1/objects"+path, create, &results, &errmsg)
+	start := time.Now()
+	resp, err := s.do("POST", "/v1/objects"+path, create, &results, &errmsg)
+	s.Logger.Debugw("icinga2 request", "method", "POST", "path", path, "duration_ms", time.Since(start).Milliseconds())
+
 	return s.handleResults("update", path, resp, &results, &errmsg, err)
 }
 
@@ -132,6 +255,7 @@ func (s *WebClient) handleResults(typ, path string, resp *napping.Response, resu
 	var resultReport string
 
 	if oerr != nil {
+		s.Logger.Errorw("icinga2 request failed", "method", typ, "path", path, "error", oerr.Error())
 		return oerr
 	}
 
@@ -147,11 +271,15 @@ func (s *WebClient) handleResults(typ, path string, resp *napping.Response, resu
 		}
 	}
 
+	s.Logger.Infow("icinga2 result", "method", typ, "path", path, "status", resp.HttpResponse().StatusCode)
+
 	if resp.HttpResponse().StatusCode >= 400 {
+		s.Logger.Errorw("icinga2 result error", "method", typ, "path", path, "icinga_result_code", resp.HttpResponse().StatusCode, "errors", resultReport)
 		return fmt.Errorf("%s %s : %s - %s", typ, path, resp.HttpResponse().Status, resultReport)
 	}
 
 	if resultReport != "" {
+		s.Logger.Errorw("icinga2 result error", "method", typ, "path", path, "errors", resultReport)
 		return fmt.Errorf("%s %s : %s\n", typ, path, resultReport)
 	}
 
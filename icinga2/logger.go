@@ -0,0 +1,17 @@
+package icinga2
+
+// Logger is a minimal structured logging interface satisfied by
+// *zap.SugaredLogger, and is the interface WebClient instruments every
+// request through. Applications that don't configure one get a no-op
+// Logger, matching the previous default of napping's Debug flag being off.
+type Logger interface {
+	Debugw(msg string, kv ...interface{})
+	Infow(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugw(msg string, kv ...interface{}) {}
+func (nopLogger) Infow(msg string, kv ...interface{})  {}
+func (nopLogger) Errorw(msg string, kv ...interface{}) {}
@@ -0,0 +1,82 @@
+package icinga2
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// SetRootCAs atomically replaces the CA pool used to verify the Icinga2 API
+// server's certificate. It is safe to call concurrently with in-flight
+// requests. Idle keep-alive connections are closed so that subsequent
+// requests on new connections perform a fresh TLS handshake against the new
+// trust store. A connection that is carrying a request at the time of the
+// call is not closed; it returns to the idle pool afterwards and can be
+// reused without a new handshake.
+func (s *WebClient) SetRootCAs(pool *x509.CertPool) {
+	s.caPool.Store(pool)
+	if s.transport != nil {
+		s.transport.CloseIdleConnections()
+	}
+}
+
+// WatchCAFile polls path and calls SetRootCAs whenever its modification
+// time moves forward, so a long-running process picks up a rotated Icinga2 CA
+// without being restarted. It loads path once synchronously before
+// returning, then continues polling at the given interval until stop is
+// called.
+func (s *WebClient) WatchCAFile(path string, interval time.Duration) (stop func(), err error) {
+	pool, modTime, err := loadCAFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s.SetRootCAs(pool)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil || !info.ModTime().After(modTime) {
+					continue
+				}
+
+				newPool, newModTime, err := loadCAFile(path)
+				if err != nil {
+					continue
+				}
+				modTime = newModTime
+				s.SetRootCAs(newPool)
+			}
+		}
+	}()
+
+	return func() { close(done) }, nil
+}
+
+func loadCAFile(path string) (*x509.CertPool, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, time.Time{}, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, info.ModTime(), nil
+}
@@ -0,0 +1,47 @@
+package icinga2
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetRootCAsMidFlight(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.leafCert(t, x509.ExtKeyUsageServerAuth)
+
+	server := httptest.NewUnstartedServer(newResultsHandler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := New(WebClient{URL: server.URL, RootCAs: ca.pool})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	if err := client.CreateObject("/hosts/test1", map[string]interface{}{"attrs": map[string]interface{}{}}); err != nil {
+		t.Fatalf("CreateObject before rotation: %s", err)
+	}
+
+	// Rotate to a pool that doesn't trust the server's CA. The idle
+	// connection left by the first request must be torn down so the next
+	// request re-verifies
+	// against the new trust store instead of reusing a keep-alive
+	// connection already validated under the old one.
+	untrusted := x509.NewCertPool()
+	client.SetRootCAs(untrusted)
+
+	if err := client.CreateObject("/hosts/test1", map[string]interface{}{"attrs": map[string]interface{}{}}); err == nil {
+		t.Fatal("expected CreateObject to fail after rotating to a CA pool that doesn't trust the server certificate")
+	}
+
+	// Rotating back to the original pool restores trust without
+	// recreating the client.
+	client.SetRootCAs(ca.pool)
+
+	if err := client.CreateObject("/hosts/test1", map[string]interface{}{"attrs": map[string]interface{}{}}); err != nil {
+		t.Fatalf("CreateObject after restoring trusted CA pool: %s", err)
+	}
+}
@@ -0,0 +1,32 @@
+package icinga2
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// stdLogger adapts a standard library *log.Logger to the Logger interface,
+// flattening the key/value pairs onto the message since log.Logger has no
+// notion of structured fields.
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger wraps l as a Logger, for applications that just want request
+// activity on the standard logger rather than a structured sink.
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+func (s *stdLogger) Debugw(msg string, kv ...interface{}) { s.logw("DEBUG", msg, kv...) }
+func (s *stdLogger) Infow(msg string, kv ...interface{})  { s.logw("INFO", msg, kv...) }
+func (s *stdLogger) Errorw(msg string, kv ...interface{}) { s.logw("ERROR", msg, kv...) }
+
+func (s *stdLogger) logw(level, msg string, kv ...interface{}) {
+	var fields []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields = append(fields, fmt.Sprintf("%v=%v", kv[i], kv[i+1]))
+	}
+	s.l.Printf("%s %s %s", level, msg, strings.Join(fields, " "))
+}
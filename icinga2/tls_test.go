@@ -0,0 +1,71 @@
+package icinga2
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newResultsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Results{})
+	}
+}
+
+func TestMutualTLSClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.leafCert(t, x509.ExtKeyUsageServerAuth)
+	clientCert := ca.leafCert(t, x509.ExtKeyUsageClientAuth)
+
+	server := httptest.NewUnstartedServer(newResultsHandler())
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := New(WebClient{
+		URL:         server.URL,
+		RootCAs:     ca.pool,
+		Certificate: &clientCert,
+	})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	if err := client.CreateObject("/hosts/test1", map[string]interface{}{"attrs": map[string]interface{}{}}); err != nil {
+		t.Fatalf("CreateObject with client certificate: %s", err)
+	}
+}
+
+func TestMutualTLSWithoutClientCertificateFails(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.leafCert(t, x509.ExtKeyUsageServerAuth)
+
+	server := httptest.NewUnstartedServer(newResultsHandler())
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := New(WebClient{
+		URL:     server.URL,
+		RootCAs: ca.pool,
+	})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	if err := client.CreateObject("/hosts/test1", map[string]interface{}{"attrs": map[string]interface{}{}}); err == nil {
+		t.Fatal("expected CreateObject to fail without a client certificate against a server requiring one")
+	}
+}
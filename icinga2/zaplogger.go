@@ -0,0 +1,10 @@
+package icinga2
+
+import "go.uber.org/zap"
+
+// NewZapLogger wraps a *zap.SugaredLogger as a Logger. SugaredLogger already
+// implements Debugw/Infow/Errorw with this exact signature, so this is
+// mostly documentation of the intended adapter.
+func NewZapLogger(l *zap.SugaredLogger) Logger {
+	return l
+}